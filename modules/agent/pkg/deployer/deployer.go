@@ -0,0 +1,55 @@
+package deployer
+
+import (
+	"time"
+
+	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+	"github.com/rancher/fleet/pkg/manifest"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Resources is the set of objects deployed for a bundle, along with the ID
+// needed to look them back up with Resources and the namespace they
+// default to.
+type Resources struct {
+	DefaultNamespace string
+	ID               string
+	Objects          []runtime.Object
+}
+
+// ReleaseInfo summarizes one entry of a deployment's history, enough to
+// pick a revision to roll back to.
+type ReleaseInfo struct {
+	Revision   int
+	Status     string
+	BundleID   string
+	DeployedAt time.Time
+}
+
+// DriftedObject identifies a single deployed object whose live spec no
+// longer matches the manifest recorded for the release it came from.
+type DriftedObject struct {
+	BundleID  string
+	GVR       schema.GroupVersionResource
+	Namespace string
+	Name      string
+}
+
+// Deployer is implemented by each supported deployment strategy.
+type Deployer interface {
+	Deploy(bundleID string, manifest *manifest.Manifest, options fleet.BundleDeploymentOptions) (*Resources, error)
+	Delete(bundleID string) error
+	ListDeployments() ([]string, error)
+	Resources(bundleID, resourcesID string) (*Resources, error)
+
+	// Rollback reverts bundleID to a previously deployed revision, so that
+	// spec.rollbackTo has a supported recovery path to call into.
+	Rollback(bundleID string, revision int, options fleet.BundleDeploymentOptions) error
+	// History returns the revisions kept for bundleID, most recent first.
+	History(bundleID string) ([]ReleaseInfo, error)
+	// Drift returns the objects belonging to bundleID whose live spec has
+	// diverged from the manifest recorded in its release, so the caller can
+	// surface a Drifted condition and optionally trigger re-apply.
+	Drift(bundleID string) ([]DriftedObject, error)
+}
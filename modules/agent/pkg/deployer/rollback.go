@@ -0,0 +1,28 @@
+package deployer
+
+import (
+	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+)
+
+// ApplyRollback reconciles a BundleDeployment's spec.rollbackTo against its
+// status: if no rollback is requested it returns nil; if one is requested
+// and hasn't been applied yet, it calls d.Rollback and returns the
+// RollbackTo to record on the status; otherwise it returns the existing
+// status value unchanged, so a reconcile that observes the same
+// spec.rollbackTo again is a no-op rather than rolling back a second time.
+func ApplyRollback(d Deployer, bundleID string, bd *fleet.BundleDeployment) (*fleet.RollbackTo, error) {
+	target := bd.Spec.RollbackTo
+	if target == nil {
+		return nil, nil
+	}
+
+	if applied := bd.Status.AppliedRollbackTo; applied != nil && *applied == *target {
+		return applied, nil
+	}
+
+	if err := d.Rollback(bundleID, target.Revision, bd.Spec.Options); err != nil {
+		return nil, err
+	}
+
+	return &fleet.RollbackTo{Revision: target.Revision}, nil
+}
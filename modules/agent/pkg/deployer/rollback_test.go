@@ -0,0 +1,119 @@
+package deployer
+
+import (
+	"testing"
+
+	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+	"github.com/rancher/fleet/pkg/manifest"
+)
+
+// fakeDeployer records the revision it was asked to roll back to, so tests
+// can assert ApplyRollback actually called into it exactly when expected.
+type fakeDeployer struct {
+	rollbackCalls []int
+	rollbackErr   error
+}
+
+func (f *fakeDeployer) Deploy(string, *manifest.Manifest, fleet.BundleDeploymentOptions) (*Resources, error) {
+	panic("not used by this test")
+}
+func (f *fakeDeployer) Delete(string) error                { panic("not used by this test") }
+func (f *fakeDeployer) ListDeployments() ([]string, error) { panic("not used by this test") }
+func (f *fakeDeployer) Resources(string, string) (*Resources, error) {
+	panic("not used by this test")
+}
+func (f *fakeDeployer) Rollback(bundleID string, revision int, _ fleet.BundleDeploymentOptions) error {
+	f.rollbackCalls = append(f.rollbackCalls, revision)
+	return f.rollbackErr
+}
+func (f *fakeDeployer) History(string) ([]ReleaseInfo, error) { panic("not used by this test") }
+func (f *fakeDeployer) Drift(string) ([]DriftedObject, error) { panic("not used by this test") }
+
+func TestApplyRollbackNoOpWhenNotRequested(t *testing.T) {
+	f := &fakeDeployer{}
+	bd := &fleet.BundleDeployment{}
+
+	got, err := ApplyRollback(f, "bundle", bd)
+	if err != nil {
+		t.Fatalf("ApplyRollback() error = %v", err)
+	}
+	if got != nil {
+		t.Errorf("ApplyRollback() = %v, want nil", got)
+	}
+	if len(f.rollbackCalls) != 0 {
+		t.Errorf("Rollback called %v, want no calls", f.rollbackCalls)
+	}
+}
+
+func TestApplyRollbackCallsRollbackWhenNotYetApplied(t *testing.T) {
+	f := &fakeDeployer{}
+	bd := &fleet.BundleDeployment{
+		Spec: fleet.BundleDeploymentSpec{RollbackTo: &fleet.RollbackTo{Revision: 3}},
+	}
+
+	got, err := ApplyRollback(f, "bundle", bd)
+	if err != nil {
+		t.Fatalf("ApplyRollback() error = %v", err)
+	}
+	if got == nil || got.Revision != 3 {
+		t.Errorf("ApplyRollback() = %v, want {Revision: 3}", got)
+	}
+	if len(f.rollbackCalls) != 1 || f.rollbackCalls[0] != 3 {
+		t.Errorf("Rollback called with %v, want exactly one call with revision 3", f.rollbackCalls)
+	}
+}
+
+func TestApplyRollbackIsIdempotentOnceApplied(t *testing.T) {
+	f := &fakeDeployer{}
+	bd := &fleet.BundleDeployment{
+		Spec:   fleet.BundleDeploymentSpec{RollbackTo: &fleet.RollbackTo{Revision: 3}},
+		Status: fleet.BundleDeploymentStatus{AppliedRollbackTo: &fleet.RollbackTo{Revision: 3}},
+	}
+
+	got, err := ApplyRollback(f, "bundle", bd)
+	if err != nil {
+		t.Fatalf("ApplyRollback() error = %v", err)
+	}
+	if got == nil || got.Revision != 3 {
+		t.Errorf("ApplyRollback() = %v, want {Revision: 3}", got)
+	}
+	if len(f.rollbackCalls) != 0 {
+		t.Errorf("Rollback called %v, want no calls (already applied)", f.rollbackCalls)
+	}
+}
+
+func TestApplyRollbackReRollsBackOnNewTarget(t *testing.T) {
+	f := &fakeDeployer{}
+	bd := &fleet.BundleDeployment{
+		Spec:   fleet.BundleDeploymentSpec{RollbackTo: &fleet.RollbackTo{Revision: 4}},
+		Status: fleet.BundleDeploymentStatus{AppliedRollbackTo: &fleet.RollbackTo{Revision: 3}},
+	}
+
+	got, err := ApplyRollback(f, "bundle", bd)
+	if err != nil {
+		t.Fatalf("ApplyRollback() error = %v", err)
+	}
+	if got == nil || got.Revision != 4 {
+		t.Errorf("ApplyRollback() = %v, want {Revision: 4}", got)
+	}
+	if len(f.rollbackCalls) != 1 || f.rollbackCalls[0] != 4 {
+		t.Errorf("Rollback called with %v, want exactly one call with revision 4", f.rollbackCalls)
+	}
+}
+
+func TestApplyRollbackPropagatesRollbackError(t *testing.T) {
+	f := &fakeDeployer{rollbackErr: errBoom}
+	bd := &fleet.BundleDeployment{
+		Spec: fleet.BundleDeploymentSpec{RollbackTo: &fleet.RollbackTo{Revision: 1}},
+	}
+
+	if _, err := ApplyRollback(f, "bundle", bd); err != errBoom {
+		t.Errorf("ApplyRollback() error = %v, want %v", err, errBoom)
+	}
+}
+
+type boomError string
+
+func (e boomError) Error() string { return string(e) }
+
+const errBoom = boomError("rollback failed")
@@ -0,0 +1,311 @@
+package helm
+
+import (
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/rancher/fleet/modules/agent/pkg/deployer"
+	"github.com/rancher/wrangler/pkg/name"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+)
+
+// driftResyncInterval is how often the informer factory re-lists each
+// watched GVR, bounding how stale a missed update notification can be.
+const driftResyncInterval = 10 * time.Minute
+
+type driftKey struct {
+	bundleID  string
+	gvr       schema.GroupVersionResource
+	namespace string
+	name      string
+}
+
+// drift watches every GVR that appears in a deployed release's manifest and
+// keeps track of which of those objects have drifted from the manifest
+// fleet recorded, without waiting for the next reconcile to notice.
+type drift struct {
+	client  dynamic.Interface
+	mapper  meta.RESTMapper
+	factory dynamicinformer.DynamicSharedInformerFactory
+
+	mu       sync.Mutex
+	watched  map[schema.GroupVersionResource]bool
+	expected map[driftKey]unstructured.Unstructured
+	drifted  map[driftKey]unstructured.Unstructured
+}
+
+func newDrift(client dynamic.Interface, mapper meta.RESTMapper) *drift {
+	return &drift{
+		client:   client,
+		mapper:   mapper,
+		factory:  dynamicinformer.NewDynamicSharedInformerFactory(client, driftResyncInterval),
+		watched:  map[schema.GroupVersionResource]bool{},
+		expected: map[driftKey]unstructured.Unstructured{},
+		drifted:  map[driftKey]unstructured.Unstructured{},
+	}
+}
+
+// watch ensures the given release's objects are tracked, starting a shared
+// informer for any GVR in manifest that isn't already being watched, and
+// seeding the cache with the manifest this bundle is expected to match.
+func (d *drift) watch(bundleID string, manifest []unstructured.Unstructured) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	ownerName := ownerNameFor(bundleID)
+	keep := make(map[driftKey]bool, len(manifest))
+
+	for _, obj := range manifest {
+		gvr, err := d.gvrFor(obj)
+		if err != nil {
+			return err
+		}
+
+		key := driftKey{
+			bundleID:  ownerName,
+			gvr:       gvr,
+			namespace: obj.GetNamespace(),
+			name:      obj.GetName(),
+		}
+		keep[key] = true
+		d.expected[key] = obj
+		delete(d.drifted, key)
+
+		if !d.watched[gvr] {
+			informer := d.factory.ForResource(gvr).Informer()
+			informer.AddEventHandler(d.handlerFor(gvr))
+			d.watched[gvr] = true
+		}
+	}
+
+	d.dropStale(ownerName, keep)
+
+	d.factory.Start(nil)
+	return nil
+}
+
+// dropStale removes every cached entry for ownerName that isn't in keep,
+// i.e. left over from a previous manifest revision of this bundle (e.g. an
+// object removed from the chart). Without this, such an entry would stay
+// "expected" forever and be reported as drifted the moment something else
+// actually deletes it - a false positive for exactly the object fleet
+// itself stopped managing. Callers must hold d.mu.
+func (d *drift) dropStale(ownerName string, keep map[driftKey]bool) {
+	for key := range d.expected {
+		if key.bundleID == ownerName && !keep[key] {
+			delete(d.expected, key)
+			delete(d.drifted, key)
+		}
+	}
+}
+
+// handlerFor builds an event handler that coalesces rapid updates to the
+// same object into a single drift/no-drift verdict per key.
+func (d *drift) handlerFor(gvr schema.GroupVersionResource) cacheResourceEventHandler {
+	return cacheResourceEventHandler{
+		onChange: func(obj interface{}) {
+			u, ok := obj.(*unstructured.Unstructured)
+			if !ok {
+				return
+			}
+
+			bundleID := u.GetAnnotations()["objectset.rio.cattle.io/id"]
+			if bundleID == "" {
+				return
+			}
+
+			key := driftKey{
+				bundleID:  bundleID,
+				gvr:       gvr,
+				namespace: u.GetNamespace(),
+				name:      u.GetName(),
+			}
+
+			d.mu.Lock()
+			defer d.mu.Unlock()
+
+			want, ok := d.expected[key]
+			if !ok {
+				// Not (or no longer) a manifest object of a release we track.
+				return
+			}
+			if objectMatches(want, *u) {
+				delete(d.drifted, key)
+			} else {
+				d.drifted[key] = *u
+			}
+		},
+		onDelete: func(obj interface{}) {
+			u, ok := unwrapDeleted(obj).(*unstructured.Unstructured)
+			if !ok {
+				return
+			}
+
+			key := driftKey{
+				bundleID:  u.GetAnnotations()["objectset.rio.cattle.io/id"],
+				gvr:       gvr,
+				namespace: u.GetNamespace(),
+				name:      u.GetName(),
+			}
+
+			d.mu.Lock()
+			defer d.mu.Unlock()
+
+			// An object we expect to exist was removed out of band: that is
+			// drift too, so flag it with the manifest's own copy.
+			if want, ok := d.expected[key]; ok {
+				d.drifted[key] = want
+			}
+		},
+	}
+}
+
+// unwrapDeleted returns the object a delete event is actually about. A
+// SharedIndexInformer that misses the delete event itself (e.g. a watch
+// drop that's only noticed on the next relist) reports it as a
+// cache.DeletedFinalStateUnknown wrapping the last known object instead of
+// the raw object; without unwrapping it here, the type assertion in
+// onDelete would fail and the drift that out-of-band delete represents
+// would be silently dropped for good; the event doesn't repeat.
+func unwrapDeleted(obj interface{}) interface{} {
+	if deleted, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		return deleted.Obj
+	}
+	return obj
+}
+
+// evict drops every cached entry for a bundleID that is no longer deployed,
+// so the cache doesn't grow without bound as bundles come and go.
+func (d *drift) evict(live map[string]bool) {
+	liveOwners := make(map[string]bool, len(live))
+	for bundleID := range live {
+		liveOwners[ownerNameFor(bundleID)] = true
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for key := range d.expected {
+		if !liveOwners[key.bundleID] {
+			delete(d.expected, key)
+			delete(d.drifted, key)
+		}
+	}
+}
+
+// objects returns the drifted objects known for bundleID.
+func (d *drift) objects(bundleID string) []deployer.DriftedObject {
+	ownerName := ownerNameFor(bundleID)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var result []deployer.DriftedObject
+	for key := range d.drifted {
+		if key.bundleID == ownerName {
+			result = append(result, deployer.DriftedObject{
+				BundleID:  bundleID,
+				GVR:       key.gvr,
+				Namespace: key.namespace,
+				Name:      key.name,
+			})
+		}
+	}
+	return result
+}
+
+// ownerNameFor returns the objectset ID fleet stamps onto every object it
+// deploys for bundleID, i.e. the value actually found in the
+// "objectset.rio.cattle.io/id" annotation at apply time.
+func ownerNameFor(bundleID string) string {
+	return name.SafeConcatName("fleet", bundleID)
+}
+
+// unstructuredObjects filters objs down to the unstructured ones, which is
+// what every object decoded from a release manifest actually is.
+func unstructuredObjects(objs []runtime.Object) []unstructured.Unstructured {
+	result := make([]unstructured.Unstructured, 0, len(objs))
+	for _, obj := range objs {
+		if u, ok := obj.(*unstructured.Unstructured); ok {
+			result = append(result, *u)
+		}
+	}
+	return result
+}
+
+// gvrFor resolves obj's GVR through the RESTMapper (i.e. discovery), rather
+// than guessing a plural from the kind, so CRDs and irregular plurals (e.g.
+// "Endpoints") resolve to the resource the API server actually serves.
+func (d *drift) gvrFor(obj unstructured.Unstructured) (schema.GroupVersionResource, error) {
+	gvk := obj.GroupVersionKind()
+
+	mapping, err := d.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return schema.GroupVersionResource{}, err
+	}
+
+	return mapping.Resource, nil
+}
+
+// objectMatches reports whether got still matches want. Rather than a
+// raw reflect.DeepEqual of "spec" - which would flag every object as
+// drifted the moment the apiserver or a mutating webhook fills in a
+// default (Deployment.spec.strategy, Service.spec.clusterIP, ...), and
+// would never catch drift at all on specless kinds such as ConfigMap or a
+// Role - it checks that every field fleet actually declared (anywhere in
+// the object, metadata and status aside) is still present with the same
+// value. Extra fields the cluster added on top are ignored.
+func objectMatches(want, got unstructured.Unstructured) bool {
+	return fieldsMatch(want.Object, got.Object, true)
+}
+
+func fieldsMatch(want, got map[string]interface{}, top bool) bool {
+	for key, wantValue := range want {
+		if top && (key == "metadata" || key == "status") {
+			continue
+		}
+
+		gotValue, ok := got[key]
+		if !ok {
+			return false
+		}
+
+		wantMap, wantIsMap := wantValue.(map[string]interface{})
+		gotMap, gotIsMap := gotValue.(map[string]interface{})
+		if wantIsMap && gotIsMap {
+			if !fieldsMatch(wantMap, gotMap, false) {
+				return false
+			}
+			continue
+		}
+		if wantIsMap != gotIsMap {
+			return false
+		}
+
+		if !reflect.DeepEqual(wantValue, gotValue) {
+			return false
+		}
+	}
+	return true
+}
+
+// cacheResourceEventHandler adapts plain add/update/delete funcs into a
+// client-go ResourceEventHandler, treating add and update identically since
+// both should converge to the same drift verdict.
+type cacheResourceEventHandler struct {
+	onChange func(obj interface{})
+	onDelete func(obj interface{})
+}
+
+func (h cacheResourceEventHandler) OnAdd(obj interface{}) { h.onChange(obj) }
+func (h cacheResourceEventHandler) OnUpdate(_, newObj interface{}) {
+	h.onChange(newObj)
+}
+func (h cacheResourceEventHandler) OnDelete(obj interface{}) { h.onDelete(obj) }
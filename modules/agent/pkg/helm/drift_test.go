@@ -0,0 +1,172 @@
+package helm
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestObjectMatches(t *testing.T) {
+	tests := []struct {
+		name  string
+		want  unstructured.Unstructured
+		got   unstructured.Unstructured
+		match bool
+	}{
+		{
+			name:  "identical objects match",
+			want:  u(map[string]interface{}{"spec": map[string]interface{}{"replicas": int64(1)}}),
+			got:   u(map[string]interface{}{"spec": map[string]interface{}{"replicas": int64(1)}}),
+			match: true,
+		},
+		{
+			name:  "server-added defaults are ignored",
+			want:  u(map[string]interface{}{"spec": map[string]interface{}{"replicas": int64(1)}}),
+			got:   u(map[string]interface{}{"spec": map[string]interface{}{"replicas": int64(1), "strategy": "RollingUpdate"}}),
+			match: true,
+		},
+		{
+			name:  "a changed declared field is drift",
+			want:  u(map[string]interface{}{"spec": map[string]interface{}{"replicas": int64(1)}}),
+			got:   u(map[string]interface{}{"spec": map[string]interface{}{"replicas": int64(2)}}),
+			match: false,
+		},
+		{
+			name:  "a removed declared field is drift",
+			want:  u(map[string]interface{}{"spec": map[string]interface{}{"replicas": int64(1)}}),
+			got:   u(map[string]interface{}{"spec": map[string]interface{}{}}),
+			match: false,
+		},
+		{
+			name:  "specless kinds (e.g. ConfigMap data) are still compared",
+			want:  u(map[string]interface{}{"data": map[string]interface{}{"key": "value"}}),
+			got:   u(map[string]interface{}{"data": map[string]interface{}{"key": "changed"}}),
+			match: false,
+		},
+		{
+			name: "metadata/status differences alone are not drift",
+			want: u(map[string]interface{}{
+				"metadata": map[string]interface{}{"resourceVersion": "1"},
+				"status":   map[string]interface{}{"ready": false},
+				"spec":     map[string]interface{}{"replicas": int64(1)},
+			}),
+			got: u(map[string]interface{}{
+				"metadata": map[string]interface{}{"resourceVersion": "2"},
+				"status":   map[string]interface{}{"ready": true},
+				"spec":     map[string]interface{}{"replicas": int64(1)},
+			}),
+			match: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := objectMatches(tt.want, tt.got); got != tt.match {
+				t.Errorf("objectMatches() = %v, want %v", got, tt.match)
+			}
+		})
+	}
+}
+
+func u(fields map[string]interface{}) unstructured.Unstructured {
+	return unstructured.Unstructured{Object: fields}
+}
+
+func TestOwnerNameForIsStable(t *testing.T) {
+	a := ownerNameFor("my-bundle")
+	b := ownerNameFor("my-bundle")
+	if a != b {
+		t.Errorf("ownerNameFor is not deterministic: %q != %q", a, b)
+	}
+	if a == ownerNameFor("other-bundle") {
+		t.Errorf("ownerNameFor collapsed two different bundle IDs to %q", a)
+	}
+}
+
+func TestDriftEvictDropsUndeployedBundles(t *testing.T) {
+	// evict only ever touches the expected/drifted caches, so it's
+	// exercised directly against them rather than through watch(), which
+	// needs a real RESTMapper to resolve GVRs.
+	d := newDrift(nil, nil)
+
+	obj := u(map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "cm", "namespace": "default"},
+		"data":     map[string]interface{}{"key": "value"},
+	})
+
+	key := driftKey{bundleID: ownerNameFor("kept"), namespace: "default", name: "cm"}
+	other := driftKey{bundleID: ownerNameFor("gone"), namespace: "default", name: "cm"}
+	d.expected[key] = obj
+	d.expected[other] = obj
+	d.drifted[other] = obj
+
+	d.evict(map[string]bool{"kept": true})
+
+	if _, ok := d.expected[key]; !ok {
+		t.Error("evict dropped a bundle that is still deployed")
+	}
+	if _, ok := d.expected[other]; ok {
+		t.Error("evict kept a bundle that is no longer deployed")
+	}
+	if _, ok := d.drifted[other]; ok {
+		t.Error("evict left a stale drifted entry for a bundle that is no longer deployed")
+	}
+}
+
+func TestDropStaleRemovesObjectsNoLongerInTheManifest(t *testing.T) {
+	// dropStale is exercised directly against the cache, like evict above,
+	// since watch() needs a real RESTMapper to resolve GVRs.
+	d := newDrift(nil, nil)
+
+	owner := ownerNameFor("bundle")
+	kept := driftKey{bundleID: owner, namespace: "default", name: "kept"}
+	removed := driftKey{bundleID: owner, namespace: "default", name: "removed-from-chart"}
+	other := driftKey{bundleID: ownerNameFor("other-bundle"), namespace: "default", name: "kept"}
+
+	obj := u(map[string]interface{}{"data": map[string]interface{}{"key": "value"}})
+	d.expected[kept] = obj
+	d.expected[removed] = obj
+	d.expected[other] = obj
+	d.drifted[removed] = obj
+
+	d.dropStale(owner, map[driftKey]bool{kept: true})
+
+	if _, ok := d.expected[kept]; !ok {
+		t.Error("dropStale removed an object still present in the manifest")
+	}
+	if _, ok := d.expected[removed]; ok {
+		t.Error("dropStale left an object no longer present in the manifest")
+	}
+	if _, ok := d.drifted[removed]; ok {
+		t.Error("dropStale left a stale drifted entry for an object no longer in the manifest")
+	}
+	if _, ok := d.expected[other]; !ok {
+		t.Error("dropStale touched a different bundle's entries")
+	}
+}
+
+func TestUnwrapDeletedHandlesDeletedFinalStateUnknown(t *testing.T) {
+	obj := u(map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "cm", "namespace": "default"},
+	})
+
+	wrapped := cache.DeletedFinalStateUnknown{Key: "default/cm", Obj: &obj}
+
+	got, ok := unwrapDeleted(wrapped).(*unstructured.Unstructured)
+	if !ok {
+		t.Fatalf("unwrapDeleted(%T) did not unwrap to *unstructured.Unstructured", wrapped)
+	}
+	if got.GetName() != "cm" {
+		t.Errorf("unwrapDeleted() name = %q, want %q", got.GetName(), "cm")
+	}
+}
+
+func TestUnwrapDeletedPassesThroughOrdinaryObjects(t *testing.T) {
+	obj := &unstructured.Unstructured{}
+
+	got := unwrapDeleted(obj)
+	if got != interface{}(obj) {
+		t.Errorf("unwrapDeleted() = %v, want the original object unchanged", got)
+	}
+}
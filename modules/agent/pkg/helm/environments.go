@@ -0,0 +1,136 @@
+package helm
+
+import (
+	"fmt"
+	"sort"
+
+	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// layeredValues returns the bundle's base values with every environment
+// values source merged on top, in the order they were declared. The bundle
+// controller resolves Bundle.spec.environments[name/selector] down to this
+// ordered list (the "defaults" environment, if any, always comes first so a
+// cluster-specific environment can still override it) before handing the
+// BundleDeployment to the agent.
+func layeredValues(options fleet.BundleDeploymentOptions) map[string]interface{} {
+	vals := map[string]interface{}{}
+	if options.Values != nil {
+		vals = options.Values.Object
+	}
+
+	for _, source := range options.EnvironmentValues {
+		vals = deepMerge(vals, source)
+	}
+
+	return vals
+}
+
+// deepMerge returns a new map with src merged on top of dst, recursing into
+// nested maps so that an environment layer only needs to specify the keys it
+// overrides rather than repeating the whole values tree. Neither dst nor src
+// is modified, since options.Values.Object is reused across the dry-run and
+// real install calls that make up a single Deploy.
+func deepMerge(dst, src map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(dst))
+	for key, value := range dst {
+		result[key] = value
+	}
+
+	for key, value := range src {
+		existing, ok := result[key]
+		if !ok {
+			result[key] = value
+			continue
+		}
+
+		existingMap, existingIsMap := existing.(map[string]interface{})
+		valueMap, valueIsMap := value.(map[string]interface{})
+		if existingIsMap && valueIsMap {
+			result[key] = deepMerge(existingMap, valueMap)
+			continue
+		}
+
+		result[key] = value
+	}
+
+	return result
+}
+
+// SelectEnvironments resolves which of a Bundle's envs apply to a cluster,
+// in the order their Values should be layered onto layeredValues: the
+// "defaults" environment (if present) always comes first, so a
+// cluster-specific environment only needs to declare the keys it
+// overrides, followed either by the environment named explicitly or, when
+// name is empty, every environment whose ClusterSelector matches
+// clusterLabels.
+func SelectEnvironments(envs map[string]fleet.EnvironmentSpec, name string, clusterLabels map[string]string) ([]fleet.EnvironmentSpec, error) {
+	var selected []fleet.EnvironmentSpec
+
+	if defaults, ok := envs[fleet.DefaultsEnvironmentName]; ok {
+		selected = append(selected, defaults)
+	}
+
+	if name != "" {
+		env, ok := envs[name]
+		if !ok {
+			return nil, fmt.Errorf("environment %q not found", name)
+		}
+		return append(selected, env), nil
+	}
+
+	// Iterate in a deterministic (sorted) order so that, when more than
+	// one environment's selector matches, the merge order doesn't depend
+	// on Go's randomized map iteration.
+	names := make([]string, 0, len(envs))
+	for envName := range envs {
+		if envName == fleet.DefaultsEnvironmentName {
+			continue
+		}
+		names = append(names, envName)
+	}
+	sort.Strings(names)
+
+	for _, envName := range names {
+		env := envs[envName]
+		if env.ClusterSelector == nil {
+			continue
+		}
+
+		selector, err := metav1.LabelSelectorAsSelector(env.ClusterSelector)
+		if err != nil {
+			return nil, fmt.Errorf("environment %q: %w", envName, err)
+		}
+		if selector.Matches(labels.Set(clusterLabels)) {
+			selected = append(selected, env)
+		}
+	}
+
+	return selected, nil
+}
+
+// environmentValues flattens the Values layers of the given environments,
+// in order, into the plain maps layeredValues deep-merges onto the
+// bundle's base values.
+func environmentValues(envs []fleet.EnvironmentSpec) []map[string]interface{} {
+	var result []map[string]interface{}
+	for _, env := range envs {
+		for _, v := range env.Values {
+			if v.Object != nil {
+				result = append(result, v.Object)
+			}
+		}
+	}
+	return result
+}
+
+// environmentKustomizeDir returns the kustomizeDir override declared by the
+// selected environment, if any, falling back to the bundle-wide setting.
+func environmentKustomizeDir(options fleet.BundleDeploymentOptions) string {
+	if options.Environment != nil && options.Environment.KustomizeDir != "" {
+		return options.Environment.KustomizeDir
+	}
+	return options.KustomizeDir
+}
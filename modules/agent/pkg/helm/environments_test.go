@@ -0,0 +1,158 @@
+package helm
+
+import (
+	"reflect"
+	"testing"
+
+	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDeepMerge(t *testing.T) {
+	tests := []struct {
+		name string
+		dst  map[string]interface{}
+		src  map[string]interface{}
+		want map[string]interface{}
+	}{
+		{
+			name: "disjoint keys are both kept",
+			dst:  map[string]interface{}{"a": "1"},
+			src:  map[string]interface{}{"b": "2"},
+			want: map[string]interface{}{"a": "1", "b": "2"},
+		},
+		{
+			name: "scalar in src overrides scalar in dst",
+			dst:  map[string]interface{}{"a": "1"},
+			src:  map[string]interface{}{"a": "2"},
+			want: map[string]interface{}{"a": "2"},
+		},
+		{
+			name: "nested maps merge instead of replacing",
+			dst: map[string]interface{}{
+				"a": map[string]interface{}{"x": "1", "y": "1"},
+			},
+			src: map[string]interface{}{
+				"a": map[string]interface{}{"y": "2", "z": "2"},
+			},
+			want: map[string]interface{}{
+				"a": map[string]interface{}{"x": "1", "y": "2", "z": "2"},
+			},
+		},
+		{
+			name: "src replaces a nested map with a scalar",
+			dst: map[string]interface{}{
+				"a": map[string]interface{}{"x": "1"},
+			},
+			src: map[string]interface{}{
+				"a": "scalar",
+			},
+			want: map[string]interface{}{"a": "scalar"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dstCopy := map[string]interface{}{}
+			for k, v := range tt.dst {
+				dstCopy[k] = v
+			}
+			srcCopy := map[string]interface{}{}
+			for k, v := range tt.src {
+				srcCopy[k] = v
+			}
+
+			got := deepMerge(tt.dst, tt.src)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("deepMerge(%v, %v) = %v, want %v", tt.dst, tt.src, got, tt.want)
+			}
+
+			if !reflect.DeepEqual(tt.dst, dstCopy) {
+				t.Errorf("deepMerge mutated dst: got %v, want unchanged %v", tt.dst, dstCopy)
+			}
+			if !reflect.DeepEqual(tt.src, srcCopy) {
+				t.Errorf("deepMerge mutated src: got %v, want unchanged %v", tt.src, srcCopy)
+			}
+		})
+	}
+}
+
+func TestSelectEnvironmentsDefaultsAlwaysComesFirst(t *testing.T) {
+	envs := map[string]fleet.EnvironmentSpec{
+		"defaults": {KustomizeDir: "defaults-dir"},
+		"prod":     {KustomizeDir: "prod-dir"},
+	}
+
+	got, err := SelectEnvironments(envs, "prod", nil)
+	if err != nil {
+		t.Fatalf("SelectEnvironments() error = %v", err)
+	}
+	if len(got) != 2 || got[0].KustomizeDir != "defaults-dir" || got[1].KustomizeDir != "prod-dir" {
+		t.Errorf("SelectEnvironments() = %+v, want [defaults, prod]", got)
+	}
+}
+
+func TestSelectEnvironmentsByName(t *testing.T) {
+	envs := map[string]fleet.EnvironmentSpec{
+		"prod": {KustomizeDir: "prod-dir"},
+		"dev":  {KustomizeDir: "dev-dir"},
+	}
+
+	got, err := SelectEnvironments(envs, "dev", nil)
+	if err != nil {
+		t.Fatalf("SelectEnvironments() error = %v", err)
+	}
+	if len(got) != 1 || got[0].KustomizeDir != "dev-dir" {
+		t.Errorf("SelectEnvironments() = %+v, want [dev]", got)
+	}
+}
+
+func TestSelectEnvironmentsUnknownNameErrors(t *testing.T) {
+	envs := map[string]fleet.EnvironmentSpec{"prod": {}}
+
+	if _, err := SelectEnvironments(envs, "no-such-env", nil); err == nil {
+		t.Fatal("expected an error for an unknown environment name")
+	}
+}
+
+func TestSelectEnvironmentsBySelectorWhenNoNameGiven(t *testing.T) {
+	envs := map[string]fleet.EnvironmentSpec{
+		"matches": {
+			ClusterSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"region": "eu"}},
+			KustomizeDir:    "eu-dir",
+		},
+		"doesnt-match": {
+			ClusterSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"region": "us"}},
+			KustomizeDir:    "us-dir",
+		},
+		"no-selector": {KustomizeDir: "unreachable-dir"},
+	}
+
+	got, err := SelectEnvironments(envs, "", map[string]string{"region": "eu"})
+	if err != nil {
+		t.Fatalf("SelectEnvironments() error = %v", err)
+	}
+	if len(got) != 1 || got[0].KustomizeDir != "eu-dir" {
+		t.Errorf("SelectEnvironments() = %+v, want only the matching selector", got)
+	}
+}
+
+func TestEnvironmentValuesFlattensInOrder(t *testing.T) {
+	envs := []fleet.EnvironmentSpec{
+		{Values: []fleet.GenericMap{{Object: map[string]interface{}{"a": "1"}}}},
+		{Values: []fleet.GenericMap{
+			{Object: map[string]interface{}{"b": "2"}},
+			{Object: map[string]interface{}{"c": "3"}},
+		}},
+	}
+
+	got := environmentValues(envs)
+	want := []map[string]interface{}{
+		{"a": "1"},
+		{"b": "2"},
+		{"c": "3"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("environmentValues() = %v, want %v", got, want)
+	}
+}
@@ -5,10 +5,12 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/rancher/fleet/modules/agent/pkg/deployer"
 	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+	"github.com/rancher/fleet/pkg/config"
 	"github.com/rancher/fleet/pkg/kustomize"
 	"github.com/rancher/fleet/pkg/manifest"
 	"github.com/rancher/fleet/pkg/render"
@@ -23,21 +25,136 @@ import (
 	"helm.sh/helm/v3/pkg/release"
 	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
 )
 
+// defaultStorageDriver and defaultMaxHistory are used when the global config
+// does not specify an override.
+const (
+	defaultStorageDriver = "secrets"
+	defaultMaxHistory    = 5
+)
+
+// storageDrivers maps the user-facing driver names accepted in the global
+// config to the values understood by action.Configuration.Init.
+var storageDrivers = map[string]string{
+	"secret":    "secrets",
+	"configmap": "configmap",
+	"memory":    "memory",
+}
+
 type helm struct {
+	namespace string
+	getter    genericclioptions.RESTClientGetter
+
+	// mu guards every use of cfg: reload takes the write lock while it
+	// swaps in a new action.Configuration, and every method that drives a
+	// helm action against cfg holds the read lock for its entire body, not
+	// just around Init, so a live reload can never run concurrently with
+	// an in-flight Deploy/Delete/Rollback/etc.
+	mu  sync.RWMutex
 	cfg action.Configuration
+
+	drift      *drift
+	kubeClient kubernetes.Interface
 }
 
+// instances tracks every live helm deployer so that a global config change
+// can re-initialize their action.Configuration without restarting the agent.
+var (
+	instancesMu sync.Mutex
+	instances   = map[*helm]struct{}{}
+)
+
 func NewHelm(namespace string, getter genericclioptions.RESTClientGetter) (deployer.Deployer, error) {
-	h := &helm{}
-	if err := h.cfg.Init(getter, namespace, "secrets", logrus.Infof); err != nil {
+	h := &helm{
+		namespace: namespace,
+		getter:    getter,
+	}
+
+	driver, maxHistory := storageOptions()
+	if err := h.reload(driver, maxHistory); err != nil {
+		return nil, err
+	}
+
+	restConfig, err := getter.ToRESTConfig()
+	if err != nil {
+		return nil, err
+	}
+	dynamicClient, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	mapper, err := getter.ToRESTMapper()
+	if err != nil {
+		return nil, err
+	}
+	h.drift = newDrift(dynamicClient, mapper)
+
+	h.kubeClient, err = kubernetes.NewForConfig(restConfig)
+	if err != nil {
 		return nil, err
 	}
-	h.cfg.Releases.MaxHistory = 5
+
+	instancesMu.Lock()
+	instances[h] = struct{}{}
+	instancesMu.Unlock()
+
 	return h, nil
 }
 
+// storageOptions reads the release storage driver and history depth from the
+// global config, falling back to the historical defaults.
+func storageOptions() (string, int) {
+	cfg := config.Get()
+
+	driver := storageDrivers[cfg.HelmReleaseStorageDriver]
+	if driver == "" {
+		driver = defaultStorageDriver
+	}
+
+	maxHistory := cfg.HelmReleaseHistoryMax
+	if maxHistory <= 0 {
+		maxHistory = defaultMaxHistory
+	}
+
+	return driver, maxHistory
+}
+
+// reload (re-)initializes the underlying action.Configuration against the
+// given storage driver and history depth. It takes the write lock, so it
+// waits out any in-flight Deploy/Delete/Rollback/etc and blocks new ones
+// until the swap is done.
+func (h *helm) reload(driver string, maxHistory int) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err := h.cfg.Init(h.getter, h.namespace, driver, logrus.Infof); err != nil {
+		return err
+	}
+	h.cfg.Releases.MaxHistory = maxHistory
+	return nil
+}
+
+// Reload re-initializes every live helm deployer against the current global
+// config. It is registered with config.Register's reload path so that
+// flipping the storage driver or history depth takes effect without an
+// agent restart.
+func Reload() error {
+	driver, maxHistory := storageOptions()
+
+	instancesMu.Lock()
+	defer instancesMu.Unlock()
+
+	for h := range instances {
+		if err := h.reload(driver, maxHistory); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func mergeMaps(base, other map[string]string) map[string]string {
 	result := map[string]string{}
 	for k, v := range base {
@@ -61,7 +178,7 @@ func (p *postRender) Run(renderedManifests *bytes.Buffer) (modifiedManifests *by
 		return nil, err
 	}
 
-	newObjs, processed, err := kustomize.Process(p.manifest, renderedManifests.Bytes(), p.opts.KustomizeDir)
+	newObjs, processed, err := kustomize.Process(p.manifest, renderedManifests.Bytes(), environmentKustomizeDir(p.opts))
 	if err != nil {
 		return nil, err
 	}
@@ -87,7 +204,20 @@ func (p *postRender) Run(renderedManifests *bytes.Buffer) (modifiedManifests *by
 	return bytes.NewBuffer(data), err
 }
 
-func (h *helm) Deploy(bundleID string, manifest *manifest.Manifest, options fleet.BundleDeploymentOptions) (*deployer.Resources, error) {
+func (h *helm) Deploy(bundleID string, manifest *manifest.Manifest, options fleet.BundleDeploymentOptions) (resources *deployer.Resources, err error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if err = h.runHooks(bundleID, hookStagePrepare, options.Hooks.Prepare); err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if cleanupErr := h.runHooks(bundleID, hookStageCleanup, options.Hooks.Cleanup); cleanupErr != nil && err == nil {
+			err = cleanupErr
+		}
+	}()
+
 	tar, err := render.ToChart(bundleID, manifest)
 	if err != nil {
 		return nil, err
@@ -103,16 +233,43 @@ func (h *helm) Deploy(bundleID string, manifest *manifest.Manifest, options flee
 	}
 	chart.Metadata.Annotations["bundleID"] = bundleID
 
-	if _, err := h.install(bundleID, chart, options, true); err != nil {
+	// A single cache is shared by the dry-run and the real install below so
+	// that an external values backend is only hit once per Deploy call.
+	cache := valuesCache{}
+
+	if _, err = h.install(bundleID, manifest, chart, options, true, cache); err != nil {
 		return nil, err
 	}
 
-	release, err := h.install(bundleID, chart, options, false)
+	if err = h.runHooks(bundleID, hookStagePreSync, options.Hooks.PreSync); err != nil {
+		return nil, err
+	}
+
+	release, err := h.install(bundleID, manifest, chart, options, false, cache)
 	if err != nil {
 		return nil, err
 	}
 
-	return releaseToResources(release)
+	if err = h.runHooks(bundleID, hookStagePostSync, options.Hooks.PostSync); err != nil {
+		return nil, err
+	}
+
+	resources, err = releaseToResources(release)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = h.drift.watch(bundleID, unstructuredObjects(resources.Objects)); err != nil {
+		return nil, err
+	}
+
+	return resources, nil
+}
+
+// Drift returns the objects belonging to bundleID whose live spec has
+// diverged from the manifest recorded in its release.
+func (h *helm) Drift(bundleID string) ([]deployer.DriftedObject, error) {
+	return h.drift.objects(bundleID), nil
 }
 
 func (h *helm) mustUninstall(bundleID string) (bool, error) {
@@ -131,10 +288,10 @@ func (h *helm) mustInstall(bundleID string) (bool, error) {
 	return false, err
 }
 
-func getOpts(options fleet.BundleDeploymentOptions) (map[string]interface{}, time.Duration, string) {
-	vals := map[string]interface{}{}
-	if options.Values != nil {
-		vals = options.Values.Object
+func getOpts(options fleet.BundleDeploymentOptions, cache valuesCache) (map[string]interface{}, time.Duration, string, error) {
+	vals, err := resolveValues(layeredValues(options), cache)
+	if err != nil {
+		return nil, 0, "", err
 	}
 
 	timeout := 10 * time.Minute
@@ -146,18 +303,27 @@ func getOpts(options fleet.BundleDeploymentOptions) (map[string]interface{}, tim
 		options.DefaultNamespace = "default"
 	}
 
-	return vals, timeout, options.DefaultNamespace
+	return vals, timeout, options.DefaultNamespace, nil
 }
 
-func (h *helm) install(bundleID string, chart *chart.Chart, options fleet.BundleDeploymentOptions, dryRun bool) (*release.Release, error) {
-	vals, timeout, namespace := getOpts(options)
+func (h *helm) install(bundleID string, manifest *manifest.Manifest, chart *chart.Chart, options fleet.BundleDeploymentOptions, dryRun bool, cache valuesCache) (*release.Release, error) {
+	vals, timeout, namespace, err := getOpts(options, cache)
+	if err != nil {
+		return nil, err
+	}
 
-	uninstall, err := h.mustUninstall(bundleID)
+	mustUninstall, err := h.mustUninstall(bundleID)
 	if err != nil {
 		return nil, err
 	}
-	if uninstall {
-		if err := h.delete(bundleID, options, dryRun); err != nil {
+	if mustUninstall {
+		// Call the bare uninstall action rather than delete: this path
+		// runs nested inside Deploy's own Prepare/Cleanup hooks, and
+		// delete's PreUninstall/Cleanup/PostUninstall hooks firing here
+		// too would double-run Cleanup - and any non-idempotent
+		// uninstall hook - once from this nested call and once from
+		// Deploy's own deferred Cleanup.
+		if err := h.uninstall(bundleID, options, dryRun); err != nil {
 			return nil, err
 		}
 		if dryRun {
@@ -182,6 +348,8 @@ func (h *helm) install(bundleID string, chart *chart.Chart, options fleet.Bundle
 		u.DryRun = dryRun
 		u.PostRenderer = &postRender{
 			bundleID: bundleID,
+			manifest: manifest,
+			opts:     options,
 		}
 		return u.Run(chart, vals)
 	}
@@ -194,11 +362,16 @@ func (h *helm) install(bundleID string, chart *chart.Chart, options fleet.Bundle
 	u.DryRun = dryRun
 	u.PostRenderer = &postRender{
 		bundleID: bundleID,
+		manifest: manifest,
+		opts:     options,
 	}
 	return u.Run(bundleID, chart, vals)
 }
 
 func (h *helm) ListDeployments() ([]string, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
 	list := action.NewList(&h.cfg)
 	list.All = true
 	releases, err := list.Run()
@@ -219,10 +392,17 @@ func (h *helm) ListDeployments() ([]string, error) {
 		}
 	}
 
+	// Drop drift entries for bundles that no longer have a release, so the
+	// cache doesn't grow without bound as bundles come and go.
+	h.drift.evict(seen)
+
 	return result, nil
 }
 
 func (h *helm) Resources(deploymentID, resourcesID string) (*deployer.Resources, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
 	hist := action.NewHistory(&h.cfg)
 
 	releases, err := hist.Run(deploymentID)
@@ -243,17 +423,50 @@ func (h *helm) Resources(deploymentID, resourcesID string) (*deployer.Resources,
 }
 
 func (h *helm) Delete(bundleID string) error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
 	return h.delete(bundleID, fleet.BundleDeploymentOptions{}, false)
 }
 
-func (h *helm) delete(bundleID string, options fleet.BundleDeploymentOptions, dryRun bool) error {
-	_, timeout, _ := getOpts(options)
+func (h *helm) delete(bundleID string, options fleet.BundleDeploymentOptions, dryRun bool) (err error) {
+	if !dryRun {
+		if err = h.runHooks(bundleID, hookStagePreUninstall, options.Hooks.PreUninstall); err != nil {
+			return err
+		}
+		defer func() {
+			if cleanupErr := h.runHooks(bundleID, hookStageCleanup, options.Hooks.Cleanup); cleanupErr != nil && err == nil {
+				err = cleanupErr
+			}
+		}()
+	}
+
+	if err = h.uninstall(bundleID, options, dryRun); err != nil {
+		return err
+	}
+
+	if !dryRun {
+		err = h.runHooks(bundleID, hookStagePostUninstall, options.Hooks.PostUninstall)
+	}
+	return err
+}
+
+// uninstall runs the helm uninstall action itself, without any of delete's
+// PreUninstall/Cleanup/PostUninstall hook handling. install calls this
+// directly - instead of delete - when it finds a release stuck in
+// StatusUninstalling, since that recovery path already runs nested inside
+// Deploy's own Prepare/Cleanup hooks.
+func (h *helm) uninstall(bundleID string, options fleet.BundleDeploymentOptions, dryRun bool) error {
+	_, timeout, _, err := getOpts(options, valuesCache{})
+	if err != nil {
+		return err
+	}
 
 	u := action.NewUninstall(&h.cfg)
 	u.DryRun = dryRun
 	u.Timeout = timeout
 
-	_, err := u.Run(bundleID)
+	_, err = u.Run(bundleID)
 	return err
 }
 
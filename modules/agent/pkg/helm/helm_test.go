@@ -0,0 +1,80 @@
+package helm
+
+import (
+	"testing"
+
+	"github.com/rancher/fleet/pkg/config"
+)
+
+func withConfig(t *testing.T, c *config.Config) {
+	t.Helper()
+	previous := config.Get()
+	if err := config.Set(c); err != nil {
+		t.Fatalf("config.Set() error = %v", err)
+	}
+	t.Cleanup(func() {
+		if err := config.Set(previous); err != nil {
+			t.Fatalf("config.Set() cleanup error = %v", err)
+		}
+	})
+}
+
+func TestStorageOptionsDefaults(t *testing.T) {
+	withConfig(t, &config.Config{})
+
+	driver, maxHistory := storageOptions()
+	if driver != defaultStorageDriver {
+		t.Errorf("driver = %q, want %q", driver, defaultStorageDriver)
+	}
+	if maxHistory != defaultMaxHistory {
+		t.Errorf("maxHistory = %d, want %d", maxHistory, defaultMaxHistory)
+	}
+}
+
+func TestStorageOptionsFromConfig(t *testing.T) {
+	tests := []struct {
+		name       string
+		cfg        config.Config
+		wantDriver string
+		wantMax    int
+	}{
+		{
+			name:       "configmap driver with custom history",
+			cfg:        config.Config{HelmReleaseStorageDriver: "configmap", HelmReleaseHistoryMax: 20},
+			wantDriver: "configmap",
+			wantMax:    20,
+		},
+		{
+			name:       "memory driver for edge agents",
+			cfg:        config.Config{HelmReleaseStorageDriver: "memory", HelmReleaseHistoryMax: 1},
+			wantDriver: "memory",
+			wantMax:    1,
+		},
+		{
+			name:       "unknown driver falls back to the default",
+			cfg:        config.Config{HelmReleaseStorageDriver: "bogus"},
+			wantDriver: defaultStorageDriver,
+			wantMax:    defaultMaxHistory,
+		},
+		{
+			name:       "non-positive history falls back to the default",
+			cfg:        config.Config{HelmReleaseStorageDriver: "secret", HelmReleaseHistoryMax: -1},
+			wantDriver: "secrets",
+			wantMax:    defaultMaxHistory,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withConfig(t, &tt.cfg)
+
+			driver, maxHistory := storageOptions()
+			if driver != tt.wantDriver {
+				t.Errorf("driver = %q, want %q", driver, tt.wantDriver)
+			}
+			if maxHistory != tt.wantMax {
+				t.Errorf("maxHistory = %d, want %d", maxHistory, tt.wantMax)
+			}
+		})
+	}
+}
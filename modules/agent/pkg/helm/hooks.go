@@ -0,0 +1,185 @@
+package helm
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"time"
+
+	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+	"github.com/rancher/wrangler/pkg/name"
+	"github.com/sirupsen/logrus"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// Hook stages, named after the equivalent helmfile lifecycle events. Prepare
+// runs at the start of Deploy, cleanup at the end of both Deploy and delete,
+// presync/postsync bracket the actual helm install/upgrade, and
+// pre/postuninstall bracket delete.
+const (
+	hookStagePrepare       = "prepare"
+	hookStagePreSync       = "presync"
+	hookStagePostSync      = "postsync"
+	hookStageCleanup       = "cleanup"
+	hookStagePreUninstall  = "preuninstall"
+	hookStagePostUninstall = "postuninstall"
+
+	defaultHookTimeout = 5 * time.Minute
+
+	// jobHookPollInterval is how often a Job-backed hook's status is polled
+	// while waiting for it to finish.
+	jobHookPollInterval = 2 * time.Second
+)
+
+// HookError records which lifecycle stage a hook failed in, so that callers
+// can surface it on the BundleDeployment status instead of a bare error.
+type HookError struct {
+	Stage string
+	Err   error
+}
+
+func (e *HookError) Error() string {
+	return fmt.Sprintf("%s hook failed: %v", e.Stage, e.Err)
+}
+
+func (e *HookError) Unwrap() error {
+	return e.Err
+}
+
+// runHooks runs every step declared for a stage, in order, aborting on the
+// first failure unless the step is marked NonFatal.
+func (h *helm) runHooks(bundleID, stage string, steps []fleet.HookStep) error {
+	for i, step := range steps {
+		if err := h.runHook(bundleID, stage, i, step); err != nil {
+			if step.NonFatal {
+				logrus.Warnf("ignoring failed %s hook %d/%d for %s: %v", stage, i+1, len(steps), bundleID, err)
+				continue
+			}
+			return &HookError{Stage: stage, Err: err}
+		}
+	}
+	return nil
+}
+
+// runHook executes a single hook step, either as a command run in the
+// agent's own context (covering schema migrations, secret fetches and
+// smoke-tests that don't need cluster resources of their own) or, when Job
+// is set, as a Kubernetes Job run to completion in the namespace this helm
+// deployer stores its releases in.
+func (h *helm) runHook(bundleID, stage string, index int, step fleet.HookStep) error {
+	if step.Job != nil {
+		return h.runJobHook(bundleID, stage, index, step)
+	}
+
+	if len(step.Command) == 0 {
+		return nil
+	}
+
+	timeout := hookTimeout(step)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, step.Command[0], step.Command[1:]...)
+	out, err := cmd.CombinedOutput()
+	if step.ShowLogs || err != nil {
+		logrus.Infof("hook output for %s: %s", bundleID, out)
+	}
+	return err
+}
+
+// runJobHook runs step.Job to completion as a Kubernetes Job, polling its
+// status rather than shelling out in-process so the hook can request its
+// own image, resources and service account. The Job (and the pods it
+// created) are removed once it finishes, successfully or not.
+//
+// The Job is created with GenerateName rather than a deterministic name: a
+// deterministic name would collide with an orphaned Job left behind by a
+// crash between Create and the deferred Delete below (or by the Delete
+// itself failing), permanently stuck on an AlreadyExists error on every
+// subsequent run until an operator removes the orphan by hand.
+func (h *helm) runJobHook(bundleID, stage string, index int, step fleet.HookStep) error {
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout(step))
+	defer cancel()
+
+	jobNamePrefix := name.SafeConcatName("fleet-hook", bundleID, stage, fmt.Sprint(index)) + "-"
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: jobNamePrefix,
+			Namespace:    h.namespace,
+		},
+		Spec: *step.Job,
+	}
+
+	jobs := h.kubeClient.BatchV1().Jobs(h.namespace)
+
+	created, err := jobs.Create(ctx, job, metav1.CreateOptions{})
+	if err != nil {
+		return err
+	}
+	jobName := created.Name
+
+	propagation := metav1.DeletePropagationBackground
+	defer func() {
+		if err := jobs.Delete(context.Background(), jobName, metav1.DeleteOptions{PropagationPolicy: &propagation}); err != nil {
+			logrus.Warnf("cleaning up hook job %s: %v", jobName, err)
+		}
+	}()
+
+	var finished *batchv1.Job
+	err = wait.PollUntilContextCancel(ctx, jobHookPollInterval, true, func(ctx context.Context) (bool, error) {
+		current, err := jobs.Get(ctx, jobName, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		if current.Status.Succeeded > 0 || current.Status.Failed > 0 {
+			finished = current
+			return true, nil
+		}
+		return false, nil
+	})
+	if err != nil {
+		return fmt.Errorf("waiting for hook job %s: %w", jobName, err)
+	}
+
+	if step.ShowLogs || finished.Status.Failed > 0 {
+		h.logJobHookOutput(jobName)
+	}
+
+	if finished.Status.Failed > 0 {
+		return fmt.Errorf("hook job %s failed", jobName)
+	}
+	return nil
+}
+
+// logJobHookOutput logs the combined output of every pod the hook Job
+// created, best-effort: a logging failure doesn't fail the hook itself.
+func (h *helm) logJobHookOutput(jobName string) {
+	pods, err := h.kubeClient.CoreV1().Pods(h.namespace).List(context.Background(), metav1.ListOptions{
+		LabelSelector: "job-name=" + jobName,
+	})
+	if err != nil {
+		logrus.Warnf("listing pods for hook job %s: %v", jobName, err)
+		return
+	}
+
+	for _, pod := range pods.Items {
+		logs, err := h.kubeClient.CoreV1().Pods(h.namespace).GetLogs(pod.Name, &corev1.PodLogOptions{}).DoRaw(context.Background())
+		if err != nil {
+			logrus.Warnf("fetching logs for hook job %s pod %s: %v", jobName, pod.Name, err)
+			continue
+		}
+		logrus.Infof("hook output for %s (pod %s): %s", jobName, pod.Name, logs)
+	}
+}
+
+func hookTimeout(step fleet.HookStep) time.Duration {
+	if step.TimeoutSeconds > 0 {
+		return time.Second * time.Duration(step.TimeoutSeconds)
+	}
+	return defaultHookTimeout
+}
@@ -0,0 +1,34 @@
+package helm
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// RegisterDefaultValuesResolvers registers the values resolver backends
+// fleet ships out of the box. It is called once from the config controller
+// at startup, which is also where a cluster operator's own config would
+// register or replace backends such as vault/awssecrets/ssm/gcpsecrets.
+func RegisterDefaultValuesResolvers() {
+	RegisterValuesResolver("file", fileResolver{})
+}
+
+// fileResolver resolves "ref+file://<path>" against a file mounted into the
+// agent's container, e.g. a Secret or ConfigMap projected as a volume. It
+// needs no external SDK, so it is always registered.
+type fileResolver struct{}
+
+func (fileResolver) Resolve(ref string) (string, error) {
+	path := strings.TrimPrefix(ref, "file://")
+	if path == "" {
+		return "", fmt.Errorf("file ref has no path")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(data), "\n"), nil
+}
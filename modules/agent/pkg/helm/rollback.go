@@ -0,0 +1,63 @@
+package helm
+
+import (
+	"sort"
+
+	"github.com/rancher/fleet/modules/agent/pkg/deployer"
+	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+	"helm.sh/helm/v3/pkg/action"
+)
+
+// Rollback rolls the named release back to revision using helm's own
+// history, so that a bundle that has Atomic=true but later drifted can be
+// recovered without hand-invoking helm on the downstream cluster.
+func (h *helm) Rollback(bundleID string, revision int, options fleet.BundleDeploymentOptions) error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	_, timeout, _, err := getOpts(options, valuesCache{})
+	if err != nil {
+		return err
+	}
+
+	r := action.NewRollback(&h.cfg)
+	r.Version = revision
+	r.Timeout = timeout
+	r.Wait = true
+
+	return r.Run(bundleID)
+}
+
+// History returns every revision helm has kept for bundleID, most recent
+// history entries first, as reported by the release's own metadata.
+func (h *helm) History(bundleID string) ([]deployer.ReleaseInfo, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	hist := action.NewHistory(&h.cfg)
+	hist.Max = h.cfg.Releases.MaxHistory
+
+	releases, err := hist.Run(bundleID)
+	if err != nil {
+		return nil, err
+	}
+
+	// action.History.Run returns releases in whatever order the storage
+	// driver lists them; sort by revision, newest first, so callers that
+	// want the latest kept revision - e.g. to validate a rollback target -
+	// can just take index 0.
+	infos := make([]deployer.ReleaseInfo, len(releases))
+	for i, release := range releases {
+		infos[i] = deployer.ReleaseInfo{
+			Revision:   release.Version,
+			Status:     release.Info.Status.String(),
+			BundleID:   release.Chart.Metadata.Annotations["bundleID"],
+			DeployedAt: release.Info.LastDeployed.Time,
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Revision > infos[j].Revision
+	})
+
+	return infos, nil
+}
@@ -0,0 +1,130 @@
+package helm
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// valuesRefPrefix marks a string leaf in options.Values as a reference to be
+// resolved against a backend rather than passed to helm verbatim, e.g.
+// "ref+vault://secret/data/foo#/bar".
+const valuesRefPrefix = "ref+"
+
+// ValuesResolver resolves a single "ref+<scheme>://..." value. Backends are
+// registered per scheme with RegisterValuesResolver, mirroring the vals
+// integration used by helmfile.
+type ValuesResolver interface {
+	Resolve(ref string) (string, error)
+}
+
+var (
+	resolversMu sync.RWMutex
+	resolvers   = map[string]ValuesResolver{}
+)
+
+// RegisterValuesResolver registers a ValuesResolver for the given URI
+// scheme, e.g. "vault", "awssecrets", "ssm", "file" or "gcpsecrets".
+// RegisterDefaultValuesResolvers wires up the schemes fleet ships by
+// default; the config controller is where a deployment would add or
+// override backends for its environment.
+func RegisterValuesResolver(scheme string, resolver ValuesResolver) {
+	resolversMu.Lock()
+	defer resolversMu.Unlock()
+	resolvers[scheme] = resolver
+}
+
+func resolverFor(scheme string) (ValuesResolver, bool) {
+	resolversMu.RLock()
+	defer resolversMu.RUnlock()
+	resolver, ok := resolvers[scheme]
+	return resolver, ok
+}
+
+// ValuesResolutionError records the ref that failed to resolve, so that it
+// can be surfaced as a distinct status condition on the BundleDeployment
+// instead of a generic deploy failure.
+type ValuesResolutionError struct {
+	Ref string
+	Err error
+}
+
+func (e *ValuesResolutionError) Error() string {
+	return fmt.Sprintf("resolving %q: %v", e.Ref, e.Err)
+}
+
+func (e *ValuesResolutionError) Unwrap() error {
+	return e.Err
+}
+
+// valuesCache memoizes resolved refs for the lifetime of a single Deploy
+// call, so that the dry-run and real install don't each hit the backend.
+type valuesCache map[string]string
+
+// resolveValues walks vals depth-first, replacing every "ref+scheme://..."
+// string leaf with the value returned by the scheme's registered resolver.
+func resolveValues(vals map[string]interface{}, cache valuesCache) (map[string]interface{}, error) {
+	resolved, err := resolveValue(vals, cache)
+	if err != nil {
+		return nil, err
+	}
+	return resolved.(map[string]interface{}), nil
+}
+
+func resolveValue(val interface{}, cache valuesCache) (interface{}, error) {
+	switch v := val.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			resolved, err := resolveValue(item, cache)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = resolved
+		}
+		return result, nil
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			resolved, err := resolveValue(item, cache)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = resolved
+		}
+		return result, nil
+	case string:
+		if !strings.HasPrefix(v, valuesRefPrefix) {
+			return v, nil
+		}
+		return resolveRef(v, cache)
+	default:
+		return v, nil
+	}
+}
+
+func resolveRef(ref string, cache valuesCache) (string, error) {
+	if value, ok := cache[ref]; ok {
+		return value, nil
+	}
+
+	uri := strings.TrimPrefix(ref, valuesRefPrefix)
+	parts := strings.SplitN(uri, "://", 2)
+	if len(parts) != 2 {
+		return "", &ValuesResolutionError{Ref: ref, Err: fmt.Errorf("not a valid ref+<scheme>:// value")}
+	}
+	scheme := parts[0]
+
+	resolver, ok := resolverFor(scheme)
+	if !ok {
+		return "", &ValuesResolutionError{Ref: ref, Err: fmt.Errorf("no values resolver registered for scheme %q", scheme)}
+	}
+
+	value, err := resolver.Resolve(uri)
+	if err != nil {
+		return "", &ValuesResolutionError{Ref: ref, Err: err}
+	}
+
+	cache[ref] = value
+	return value, nil
+}
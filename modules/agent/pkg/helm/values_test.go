@@ -0,0 +1,127 @@
+package helm
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+)
+
+type stubResolver struct {
+	values map[string]string
+	err    error
+}
+
+func (s stubResolver) Resolve(ref string) (string, error) {
+	if s.err != nil {
+		return "", s.err
+	}
+	return s.values[ref], nil
+}
+
+func withResolver(t *testing.T, scheme string, resolver ValuesResolver) {
+	t.Helper()
+	resolversMu.Lock()
+	previous, had := resolvers[scheme]
+	resolvers[scheme] = resolver
+	resolversMu.Unlock()
+
+	t.Cleanup(func() {
+		resolversMu.Lock()
+		defer resolversMu.Unlock()
+		if had {
+			resolvers[scheme] = previous
+		} else {
+			delete(resolvers, scheme)
+		}
+	})
+}
+
+func TestResolveValuesReplacesRefLeaves(t *testing.T) {
+	withResolver(t, "stub", stubResolver{values: map[string]string{
+		"stub://secret": "s3cr3t",
+	}})
+
+	vals := map[string]interface{}{
+		"plain": "unchanged",
+		"nested": map[string]interface{}{
+			"password": "ref+stub://secret",
+		},
+		"list": []interface{}{"ref+stub://secret", "unchanged"},
+	}
+
+	resolved, err := resolveValues(vals, valuesCache{})
+	if err != nil {
+		t.Fatalf("resolveValues() error = %v", err)
+	}
+
+	want := map[string]interface{}{
+		"plain": "unchanged",
+		"nested": map[string]interface{}{
+			"password": "s3cr3t",
+		},
+		"list": []interface{}{"s3cr3t", "unchanged"},
+	}
+	if !reflect.DeepEqual(resolved, want) {
+		t.Errorf("resolveValues() = %v, want %v", resolved, want)
+	}
+}
+
+func TestResolveValuesUnknownScheme(t *testing.T) {
+	vals := map[string]interface{}{"key": "ref+nosuchscheme://x"}
+
+	_, err := resolveValues(vals, valuesCache{})
+	if err == nil {
+		t.Fatal("expected an error for an unregistered scheme, got nil")
+	}
+
+	var resolutionErr *ValuesResolutionError
+	if !errors.As(err, &resolutionErr) {
+		t.Fatalf("expected a *ValuesResolutionError, got %T: %v", err, err)
+	}
+	if resolutionErr.Ref != "ref+nosuchscheme://x" {
+		t.Errorf("Ref = %q, want %q", resolutionErr.Ref, "ref+nosuchscheme://x")
+	}
+}
+
+func TestResolveValuesCachesPerRef(t *testing.T) {
+	calls := 0
+	withResolver(t, "stub", stubResolverFunc(func(ref string) (string, error) {
+		calls++
+		return "value", nil
+	}))
+
+	cache := valuesCache{}
+	vals := map[string]interface{}{
+		"a": "ref+stub://x",
+		"b": "ref+stub://x",
+	}
+
+	if _, err := resolveValues(vals, cache); err != nil {
+		t.Fatalf("resolveValues() error = %v", err)
+	}
+
+	if calls != 1 {
+		t.Errorf("resolver called %d times, want 1 (cache should dedupe identical refs)", calls)
+	}
+}
+
+type stubResolverFunc func(ref string) (string, error)
+
+func (f stubResolverFunc) Resolve(ref string) (string, error) { return f(ref) }
+
+func TestFileResolver(t *testing.T) {
+	f := t.TempDir() + "/value"
+	if err := os.WriteFile(f, []byte("hello\n"), 0o600); err != nil {
+		t.Fatalf("os.WriteFile() error = %v", err)
+	}
+
+	got, err := (fileResolver{}).Resolve(fmt.Sprintf("file://%s", f))
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if got != "hello" {
+		t.Errorf("Resolve() = %q, want %q", got, "hello")
+	}
+}
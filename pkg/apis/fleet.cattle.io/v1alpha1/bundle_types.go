@@ -0,0 +1,57 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Bundle is a set of Kubernetes resources, as a chart plus values, that
+// fleet deploys as a BundleDeployment to every cluster it targets.
+type Bundle struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec BundleSpec `json:"spec,omitempty"`
+}
+
+// BundleSpec is the desired state of a Bundle.
+type BundleSpec struct {
+	// Environments are named, layerable sets of values and overrides a
+	// BundleDeployment can select from, by name or by matching a target
+	// cluster's labels against ClusterSelector. Borrowed from helmfile's
+	// environments model, this replaces fanning out near-duplicate
+	// BundleDeployments per cluster group.
+	//
+	// The entry named "defaults", if present, is always applied first to
+	// every cluster, so a more specific environment only needs to declare
+	// the values it overrides.
+	Environments map[string]EnvironmentSpec `json:"environments,omitempty"`
+}
+
+// DefaultsEnvironmentName is the reserved Environments key that, if
+// present, is applied to every cluster ahead of any environment selected
+// by name or ClusterSelector.
+const DefaultsEnvironmentName = "defaults"
+
+// EnvironmentSpec is one named layer of values and overrides a
+// BundleDeployment can pull in.
+type EnvironmentSpec struct {
+	// ClusterSelector matches this environment against a target cluster's
+	// labels when a BundleDeployment doesn't name an environment
+	// explicitly. Ignored for the "defaults" environment, which always
+	// applies.
+	ClusterSelector *metav1.LabelSelector `json:"clusterSelector,omitempty"`
+
+	// Values are deep-merged, in order, on top of the bundle's base
+	// values and any earlier environment layers.
+	Values []GenericMap `json:"values,omitempty"`
+
+	// KustomizeDir overrides the bundle-wide kustomizeDir for clusters
+	// this environment applies to.
+	KustomizeDir string `json:"kustomizeDir,omitempty"`
+}
+
+// GenericMap holds arbitrary, unstructured data, such as a layer of helm
+// values.
+type GenericMap struct {
+	Object map[string]interface{} `json:"-"`
+}
@@ -0,0 +1,79 @@
+package v1alpha1
+
+import (
+	batchv1 "k8s.io/api/batch/v1"
+)
+
+// BundleDeploymentOptions are the deploy-time settings for a single bundle
+// on a single downstream cluster, computed by the fleet controller from the
+// owning Bundle (plus any per-cluster target customization) and handed to
+// the agent's deployer.Deployer as-is.
+type BundleDeploymentOptions struct {
+	// DefaultNamespace is used for resources that don't specify a
+	// namespace of their own. Defaults to "default".
+	DefaultNamespace string `json:"defaultNamespace,omitempty"`
+
+	// TimeoutSeconds bounds how long helm waits for a deploy or delete to
+	// finish. Defaults to 10 minutes.
+	TimeoutSeconds int `json:"timeoutSeconds,omitempty"`
+
+	// KustomizeDir points at a kustomization layered over the rendered
+	// chart, relative to the bundle's manifest.
+	KustomizeDir string `json:"kustomizeDir,omitempty"`
+
+	// Hooks declares commands or Jobs to run around deploy/delete, modeled
+	// on the event system used by helmfile.
+	Hooks Hooks `json:"hooks,omitempty"`
+
+	// Values are the bundle's base chart values, before any Environment
+	// layer is merged on top.
+	Values *GenericMap `json:"values,omitempty"`
+
+	// EnvironmentValues are the resolved Environments layers selected for
+	// this cluster, in the order they should be deep-merged onto Values -
+	// the "defaults" environment, if any, always comes first.
+	EnvironmentValues []map[string]interface{} `json:"environmentValues,omitempty"`
+
+	// Environment is the most specific environment selected for this
+	// cluster, consulted for overrides - such as KustomizeDir - that apply
+	// once rather than merge.
+	Environment *EnvironmentSpec `json:"environment,omitempty"`
+}
+
+// Hooks groups the lifecycle stages a BundleDeployment can hang steps off
+// of. Prepare runs at the start of deploy, cleanup at the end of both deploy
+// and delete, presync and postsync bracket the actual helm install/upgrade,
+// and pre/postuninstall bracket delete.
+type Hooks struct {
+	Prepare       []HookStep `json:"prepare,omitempty"`
+	PreSync       []HookStep `json:"presync,omitempty"`
+	PostSync      []HookStep `json:"postsync,omitempty"`
+	Cleanup       []HookStep `json:"cleanup,omitempty"`
+	PreUninstall  []HookStep `json:"preuninstall,omitempty"`
+	PostUninstall []HookStep `json:"postuninstall,omitempty"`
+}
+
+// HookStep is a single step of a lifecycle event, run either as a command
+// in the agent's own context or, when Job is set, as a Kubernetes Job run
+// to completion in the namespace the agent's helm deployer stores its
+// releases in.
+type HookStep struct {
+	// Command is run in the agent's own context. Ignored if Job is set.
+	Command []string `json:"command,omitempty"`
+
+	// Job, if set, is run as a Kubernetes Job instead of Command, so the
+	// step can request its own image, resources and service account.
+	Job *batchv1.JobSpec `json:"job,omitempty"`
+
+	// ShowLogs logs the step's output even on success. Failures are always
+	// logged.
+	ShowLogs bool `json:"showLogs,omitempty"`
+
+	// TimeoutSeconds bounds how long the step is allowed to run. Defaults
+	// to 5 minutes.
+	TimeoutSeconds int `json:"timeoutSeconds,omitempty"`
+
+	// NonFatal lets the remaining steps (and the deploy/delete itself)
+	// proceed even if this step fails.
+	NonFatal bool `json:"nonFatal,omitempty"`
+}
@@ -0,0 +1,50 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// BundleDeployment is the per-cluster record of a Bundle's rollout, created
+// by the fleet controller and reconciled by the agent running on the
+// downstream cluster.
+type BundleDeployment struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   BundleDeploymentSpec   `json:"spec,omitempty"`
+	Status BundleDeploymentStatus `json:"status,omitempty"`
+}
+
+// BundleDeploymentSpec is what the fleet controller wants deployed.
+type BundleDeploymentSpec struct {
+	// DeploymentID identifies the manifest/options pair this deployment
+	// should converge to.
+	DeploymentID string `json:"deploymentID,omitempty"`
+
+	// Options are handed to deployer.Deployer.Deploy as-is.
+	Options BundleDeploymentOptions `json:"options,omitempty"`
+
+	// RollbackTo, when set, asks the agent to roll the release back to a
+	// previously deployed revision instead of converging to DeploymentID -
+	// the recovery path for a Deploy that set Atomic=true but the cluster
+	// later drifted. Cleared (or left unset) once the rollback no longer
+	// applies.
+	RollbackTo *RollbackTo `json:"rollbackTo,omitempty"`
+}
+
+// RollbackTo names a previously deployed helm revision, as reported by
+// deployer.Deployer.History.
+type RollbackTo struct {
+	Revision int `json:"revision"`
+}
+
+// BundleDeploymentStatus is what the agent has actually done.
+type BundleDeploymentStatus struct {
+	// AppliedDeploymentID is the DeploymentID last successfully deployed.
+	AppliedDeploymentID string `json:"appliedDeploymentID,omitempty"`
+
+	// AppliedRollbackTo records the RollbackTo the agent has already
+	// acted on, so a reconcile that observes the same spec.rollbackTo
+	// again doesn't roll back a second time.
+	AppliedRollbackTo *RollbackTo `json:"appliedRollbackTo,omitempty"`
+}
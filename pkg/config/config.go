@@ -0,0 +1,74 @@
+// Package config holds the fleet agent's view of the global ConfigMap, the
+// one place cluster-wide settings live so they can be changed without
+// rebuilding or restarting every agent.
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// ManagerConfigName is the name of the ConfigMap, in the agent's own
+// namespace, that pkg/controllers/config watches for changes.
+const ManagerConfigName = "fleet-agent"
+
+// configKey is the Data key under which the JSON-encoded Config is stored,
+// so the ConfigMap can carry other, unrelated keys alongside it.
+const configKey = "config"
+
+// Config is the set of cluster-wide settings an operator can change without
+// restarting every agent.
+type Config struct {
+	// HelmReleaseStorageDriver selects where helm stores release objects:
+	// "secret" (the default), "configmap", or "memory". Downstreams running
+	// many bundles per cluster may prefer "configmap" for size reasons;
+	// small edge agents may prefer "memory" to avoid etcd churn.
+	HelmReleaseStorageDriver string `json:"helmReleaseStorageDriver,omitempty"`
+
+	// HelmReleaseHistoryMax caps how many revisions helm keeps per release.
+	// Defaults to 5 when unset or non-positive.
+	HelmReleaseHistoryMax int `json:"helmReleaseHistoryMax,omitempty"`
+}
+
+var (
+	mu  sync.RWMutex
+	cfg = &Config{}
+)
+
+// Get returns the currently active Config. It is always non-nil; callers
+// that haven't seen a ConfigMap yet get the zero value, which every reader
+// is expected to treat as "use the default".
+func Get() *Config {
+	mu.RLock()
+	defer mu.RUnlock()
+	c := *cfg
+	return &c
+}
+
+// Set replaces the currently active Config. It is called by the config
+// controller whenever the watched ConfigMap changes.
+func Set(c *Config) error {
+	mu.Lock()
+	defer mu.Unlock()
+	cfg = c
+	return nil
+}
+
+// ReadConfig decodes the Config stored under configKey in configMap's Data,
+// returning the zero Config if the key is absent so a ConfigMap created
+// without it still resolves to the documented defaults.
+func ReadConfig(configMap *v1.ConfigMap) (*Config, error) {
+	raw, ok := configMap.Data[configKey]
+	if !ok {
+		return &Config{}, nil
+	}
+
+	c := &Config{}
+	if err := json.Unmarshal([]byte(raw), c); err != nil {
+		return nil, fmt.Errorf("decoding %s ConfigMap: %w", ManagerConfigName, err)
+	}
+	return c, nil
+}
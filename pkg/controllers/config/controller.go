@@ -3,6 +3,7 @@ package config
 import (
 	"context"
 
+	"github.com/rancher/fleet/modules/agent/pkg/helm"
 	"github.com/rancher/fleet/pkg/config"
 	corecontrollers "github.com/rancher/wrangler-api/pkg/generated/controllers/core/v1"
 	v1 "k8s.io/api/core/v1"
@@ -12,6 +13,8 @@ func Register(ctx context.Context,
 	namespace string,
 	cm corecontrollers.ConfigMapController) error {
 
+	helm.RegisterDefaultValuesResolvers()
+
 	cm.OnChange(ctx, "global-config", func(_ string, configMap *v1.ConfigMap) (*v1.ConfigMap, error) {
 		return reloadConfig(namespace, configMap)
 	})
@@ -34,5 +37,12 @@ func reloadConfig(namespace string, configMap *v1.ConfigMap) (*v1.ConfigMap, err
 		return configMap, err
 	}
 
-	return configMap, config.Set(cfg)
+	if err := config.Set(cfg); err != nil {
+		return configMap, err
+	}
+
+	// Existing helm deployers keep an action.Configuration bound to the
+	// storage driver they were created with, so a driver or history change
+	// needs to be pushed to them explicitly instead of waiting on a restart.
+	return configMap, helm.Reload()
 }
\ No newline at end of file